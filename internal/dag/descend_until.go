@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package dag
+
+// DescendUntil performs a breadth-first traversal of the descendants of
+// start, calling stop on each vertex as it is visited. As with Descendents,
+// descendants are found by following up-edges: the vertices that depend on
+// start, directly or indirectly. When stop returns true for a vertex, that
+// vertex is collected into the result and the traversal does not continue
+// through its up-edges. Traversal continues
+// unimpeded along any other branch, so a vertex whose only path from start
+// passes through a "stopped" vertex will not be visited, while a vertex
+// that's also reachable via a different branch whose ancestors all
+// returned false from stop will still be visited (and possibly also
+// collected, if stop then returns true for it as well).
+//
+// This is useful for finding the "first" interesting nodes along every
+// branch from start without needing to know the full depth of the graph,
+// and without forcing a caller to manually walk edges and track visited
+// state themselves. start itself is not passed to stop.
+func (g *AcyclicGraph) DescendUntil(start Vertex, stop func(Vertex) bool) []Vertex {
+	var stopped []Vertex
+
+	seen := make(map[Vertex]bool)
+	queue := g.UpEdges(start).List()
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+
+		if stop(current) {
+			stopped = append(stopped, current)
+			continue
+		}
+
+		queue = append(queue, g.UpEdges(current).List()...)
+	}
+
+	return stopped
+}
@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package dag
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAcyclicGraphDescendUntil_diamond(t *testing.T) {
+	//   a
+	//  / \
+	// b   c
+	//  \ /
+	//   d
+	//
+	// Each edge points from a vertex to the one drawn above it, which it
+	// depends on, so every vertex below a is a descendant of a.
+	var g AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Add("c")
+	g.Add("d")
+	g.Connect(BasicEdge("b", "a"))
+	g.Connect(BasicEdge("c", "a"))
+	g.Connect(BasicEdge("d", "b"))
+	g.Connect(BasicEdge("d", "c"))
+
+	got := g.DescendUntil("a", func(v Vertex) bool {
+		return v == "d"
+	})
+
+	if !reflect.DeepEqual(got, []Vertex{"d"}) {
+		t.Fatalf("wrong result: %#v", got)
+	}
+}
+
+func TestAcyclicGraphDescendUntil_pruning(t *testing.T) {
+	//     a
+	//    / \
+	//   b   c
+	//   |   |
+	//   d   e (stop)
+	//       |
+	//       f
+	var g AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Add("c")
+	g.Add("d")
+	g.Add("e")
+	g.Add("f")
+	g.Connect(BasicEdge("b", "a"))
+	g.Connect(BasicEdge("c", "a"))
+	g.Connect(BasicEdge("d", "b"))
+	g.Connect(BasicEdge("e", "c"))
+	g.Connect(BasicEdge("f", "e"))
+
+	got := g.DescendUntil("a", func(v Vertex) bool {
+		return v == "e"
+	})
+
+	// f must not appear: descent through e (a stopped vertex) is pruned,
+	// and f is not reachable via any other branch.
+	if !reflect.DeepEqual(got, []Vertex{"e"}) {
+		t.Fatalf("wrong result: %#v", got)
+	}
+}
+
+func TestAcyclicGraphDescendUntil_moduleCloseIntermediary(t *testing.T) {
+	// Simulates an ephemeral resource ("eph") whose consumer ("ref") is
+	// nested a couple of levels below intermediary, non-referencer nodes
+	// like module close nodes ("modclose1", "modclose2"), which should be
+	// descended through rather than stopped on.
+	var g AcyclicGraph
+	g.Add("eph")
+	g.Add("modclose1")
+	g.Add("modclose2")
+	g.Add("ref")
+	g.Connect(BasicEdge("modclose1", "eph"))
+	g.Connect(BasicEdge("modclose2", "modclose1"))
+	g.Connect(BasicEdge("ref", "modclose2"))
+
+	isReferencer := map[Vertex]bool{"ref": true}
+
+	got := g.DescendUntil("eph", func(v Vertex) bool {
+		return isReferencer[v]
+	})
+
+	if !reflect.DeepEqual(got, []Vertex{"ref"}) {
+		t.Fatalf("wrong result: %#v", got)
+	}
+}
+
+func TestAcyclicGraphDescendUntil_multiplePathsRejoin(t *testing.T) {
+	// A vertex reachable both through a stopped branch and a non-stopped
+	// branch must still be visited via the non-stopped branch.
+	//
+	//      a
+	//    /   \
+	//   b     c (stop)
+	//    \   /
+	//      d
+	var g AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Add("c")
+	g.Add("d")
+	g.Connect(BasicEdge("b", "a"))
+	g.Connect(BasicEdge("c", "a"))
+	g.Connect(BasicEdge("d", "b"))
+	g.Connect(BasicEdge("d", "c"))
+
+	var visited []Vertex
+	got := g.DescendUntil("a", func(v Vertex) bool {
+		visited = append(visited, v)
+		return v == "c" || v == "d"
+	})
+
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].(string) < got[j].(string)
+	})
+	if !reflect.DeepEqual(got, []Vertex{"c", "d"}) {
+		t.Fatalf("wrong result: %#v", got)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// GraphNodeEphemeralCloseOrdering is implemented by resource nodes that
+// need to constrain when their ephemeral resource is closed relative to
+// other ephemeral resources, beyond what ephemeralResourceCloseTransformer
+// already infers from referencer edges in the configuration graph. A
+// typical case is one ephemeral resource using the result of another (for
+// example, a database credential minted with a vault token), where the
+// token must stay open until the credential has been closed.
+//
+// ephemeralResourceCloseTransformer consults this after building the
+// default close edges, and adds a dag.BasicEdge from each dependency's
+// close node to this resource's close node, so the dependency's close node
+// runs no earlier than this resource's close node does.
+type GraphNodeEphemeralCloseOrdering interface {
+	// EphemeralCloseBefore returns the addresses of other ephemeral
+	// resources that must not be closed until this resource's own close
+	// node has run.
+	EphemeralCloseBefore() []addrs.ConfigResource
+}
@@ -0,0 +1,187 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package terraform
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+	"github.com/hashicorp/terraform/internal/dag"
+	"github.com/hashicorp/terraform/internal/tfdiags"
+)
+
+// testOrderedEphemeralResourceNode is a minimal GraphNodeConfigResource
+// that also implements GraphNodeEphemeralCloseOrdering, standing in for an
+// ephemeral resource node whose provider requires another ephemeral
+// resource to stay open until it has closed. Like a real ephemeral resource
+// node it is a GraphNodeProviderConsumer, which the registered ephemeral
+// close node factory requires; it needs no provider.
+type testOrderedEphemeralResourceNode struct {
+	addr        addrs.ConfigResource
+	closeBefore []addrs.ConfigResource
+}
+
+func (n *testOrderedEphemeralResourceNode) ResourceAddr() addrs.ConfigResource {
+	return n.addr
+}
+
+func (n *testOrderedEphemeralResourceNode) ModulePath() addrs.Module {
+	return n.addr.Module
+}
+
+func (n *testOrderedEphemeralResourceNode) ProvidedBy() (addrs.ProviderConfig, bool) {
+	return nil, true
+}
+
+func (n *testOrderedEphemeralResourceNode) Provider() addrs.Provider {
+	return addrs.Provider{}
+}
+
+func (n *testOrderedEphemeralResourceNode) SetProvider(addrs.AbsProviderConfig) {}
+
+func (n *testOrderedEphemeralResourceNode) String() string {
+	return n.addr.String()
+}
+
+func (n *testOrderedEphemeralResourceNode) EphemeralCloseBefore() []addrs.ConfigResource {
+	return n.closeBefore
+}
+
+func ephemeralConfigResource(typeName, name string) addrs.ConfigResource {
+	return addrs.ConfigResource{
+		Resource: addrs.Resource{
+			Mode: addrs.EphemeralResourceMode,
+			Type: typeName,
+			Name: name,
+		},
+		Module: addrs.RootModule,
+	}
+}
+
+// TestResourceLifecycleCloseTransformer_ephemeralCloseOrdering exercises
+// the chained-ephemeral-resource scenario described by
+// GraphNodeEphemeralCloseOrdering: an ephemeral database credential ("db")
+// that was minted using an ephemeral vault token ("token") must be closed
+// before the token is closed, so the token is never closed while the
+// credential derived from it might still need it, even though neither
+// resource references the other directly in a way the graph would
+// otherwise order.
+func TestResourceLifecycleCloseTransformer_ephemeralCloseOrdering(t *testing.T) {
+	tokenAddr := ephemeralConfigResource("vault_token", "example")
+	dbAddr := ephemeralConfigResource("vault_database_credential", "example")
+
+	tokenNode := &testOrderedEphemeralResourceNode{addr: tokenAddr}
+	dbNode := &testOrderedEphemeralResourceNode{
+		addr:        dbAddr,
+		closeBefore: []addrs.ConfigResource{tokenAddr},
+	}
+
+	g := &Graph{}
+	g.Add(tokenNode)
+	g.Add(dbNode)
+
+	tr := &resourceLifecycleCloseTransformer{
+		modes: []addrs.ResourceMode{addrs.EphemeralResourceMode},
+	}
+	if err := tr.Transform(g); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var tokenClose, dbClose *nodeEphemeralResourceClose
+	for _, v := range g.Vertices() {
+		c, ok := v.(*nodeEphemeralResourceClose)
+		if !ok {
+			continue
+		}
+		switch c.addr.String() {
+		case tokenAddr.String():
+			tokenClose = c
+		case dbAddr.String():
+			dbClose = c
+		}
+	}
+	if tokenClose == nil || dbClose == nil {
+		t.Fatal("close nodes were not created for both resources")
+	}
+
+	// The token's close node must depend on the db credential's close
+	// node, so the token is never closed while the credential derived
+	// from it might still need it.
+	if !g.DownEdges(tokenClose).Include(dbClose) {
+		t.Error("token close node is not ordered after the db close node")
+	}
+	if g.DownEdges(dbClose).Include(tokenClose) {
+		t.Error("db close node must not depend on the token close node")
+	}
+
+	// Cross-check against the order the graph actually executes in, so
+	// that an inverted edge here can't hide an inverted edge in the
+	// production code (or vice versa).
+	var mu sync.Mutex
+	var order []string
+	diags := g.AcyclicGraph.Walk(func(v dag.Vertex) tfdiags.Diagnostics {
+		if c, ok := v.(*nodeEphemeralResourceClose); ok {
+			mu.Lock()
+			order = append(order, c.addr.String())
+			mu.Unlock()
+		}
+		return nil
+	})
+	if diags.HasErrors() {
+		t.Fatalf("walk failed: %s", diags.Err())
+	}
+
+	dbIdx, tokenIdx := -1, -1
+	for i, addr := range order {
+		switch addr {
+		case dbAddr.String():
+			dbIdx = i
+		case tokenAddr.String():
+			tokenIdx = i
+		}
+	}
+	if dbIdx == -1 || tokenIdx == -1 {
+		t.Fatalf("walk did not visit both close nodes: %v", order)
+	}
+	if dbIdx > tokenIdx {
+		t.Errorf("db close node was walked after the token close node: %v", order)
+	}
+}
+
+func TestResourceLifecycleCloseTransformer_ephemeralCloseOrdering_unknownDependency(t *testing.T) {
+	dbAddr := ephemeralConfigResource("vault_database_credential", "example")
+	missingAddr := ephemeralConfigResource("vault_token", "not_in_graph")
+
+	dbNode := &testOrderedEphemeralResourceNode{
+		addr:        dbAddr,
+		closeBefore: []addrs.ConfigResource{missingAddr},
+	}
+
+	g := &Graph{}
+	g.Add(dbNode)
+
+	tr := &resourceLifecycleCloseTransformer{
+		modes: []addrs.ResourceMode{addrs.EphemeralResourceMode},
+	}
+	if err := tr.Transform(g); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A dependency on a resource with no close node in this graph is
+	// silently ignored rather than causing an error: the dependency may
+	// simply not be part of this particular graph walk.
+	var dbClose dag.Vertex
+	for _, v := range g.Vertices() {
+		if c, ok := v.(*nodeEphemeralResourceClose); ok && c.addr.String() == dbAddr.String() {
+			dbClose = c
+		}
+	}
+	if dbClose == nil {
+		t.Fatal("close node was not created")
+	}
+	if len(g.DownEdges(dbClose)) != 1 {
+		t.Errorf("expected exactly one down-edge (to the resource itself), got %d", len(g.DownEdges(dbClose)))
+	}
+}
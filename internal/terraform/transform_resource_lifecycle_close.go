@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package terraform
+
+import (
+	"log"
+	"sync"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+	"github.com/hashicorp/terraform/internal/dag"
+)
+
+// closeNodeFactory builds the close node for a resource of the
+// ResourceMode it was registered against. See RegisterCloseTransformer.
+type closeNodeFactory func(GraphNodeConfigResource) dag.Vertex
+
+var (
+	closeTransformersMu sync.Mutex
+	closeTransformers   = map[addrs.ResourceMode]closeNodeFactory{}
+)
+
+// RegisterCloseTransformer registers a close-node factory for the given
+// resource mode, so that a resourceLifecycleCloseTransformer covering that
+// mode will insert a close node for every resource of that mode and
+// connect it to the first referencer reached while descending from the
+// resource on each branch of the graph.
+//
+// This exists so that resource modes with "close" lifecycle semantics
+// (ephemeral resources today; deferred, streamed, or write-only resources
+// potentially in the future) can plug their close node into the graph
+// without reimplementing the traversal that decides where to attach it.
+// It's expected to be called from init functions.
+//
+// Registering a factory here is not by itself enough to get a close node
+// inserted into a real graph: some graph-building step still needs to run
+// a resourceLifecycleCloseTransformer that covers the mode (either with an
+// empty modes list, or explicitly naming it). ephemeralResourceCloseTransformer
+// is the only such step today, and it only covers addrs.EphemeralResourceMode.
+func RegisterCloseTransformer(mode addrs.ResourceMode, factory func(GraphNodeConfigResource) dag.Vertex) {
+	closeTransformersMu.Lock()
+	defer closeTransformersMu.Unlock()
+	closeTransformers[mode] = factory
+}
+
+// resourceLifecycleCloseTransformer is a graph transformer that inserts a
+// close node for each resource whose mode has a factory registered via
+// RegisterCloseTransformer, and arranges for the close node to depend on
+// the first referencer reached while descending from the resource on each
+// branch of the graph.
+//
+// ephemeralResourceCloseTransformer is implemented as a thin wrapper
+// around this transformer, restricted to addrs.EphemeralResourceMode.
+type resourceLifecycleCloseTransformer struct {
+	// modes restricts which registered resource modes this instance acts
+	// on. If empty, every registered mode is processed.
+	modes []addrs.ResourceMode
+}
+
+func (t *resourceLifecycleCloseTransformer) Transform(g *Graph) error {
+	closeNodesByAddr := make(map[string]dag.Vertex)
+
+	verts := g.Vertices()
+	for _, v := range verts {
+		v, ok := v.(GraphNodeConfigResource)
+		if !ok {
+			continue
+		}
+		addr := v.ResourceAddr()
+
+		if len(t.modes) > 0 && !resourceModeIncluded(t.modes, addr.Resource.Mode) {
+			continue
+		}
+
+		closeTransformersMu.Lock()
+		factory, ok := closeTransformers[addr.Resource.Mode]
+		closeTransformersMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		closeNode := factory(v)
+		log.Printf("[TRACE] resourceLifecycleCloseTransformer: adding close node for %s", addr)
+		g.Add(closeNode)
+		g.Connect(dag.BasicEdge(closeNode, v))
+		closeNodesByAddr[addr.String()] = closeNode
+
+		// Connect to the first referencer reached on each branch
+		// descending from the resource, rather than to every descendant:
+		// anything further down the chain is already covered transitively
+		// once that referencer is evaluated.
+		for _, des := range g.DescendUntil(v, func(des dag.Vertex) bool {
+			_, ok := des.(GraphNodeReferencer)
+			return ok
+		}) {
+			g.Connect(dag.BasicEdge(closeNode, des))
+		}
+	}
+
+	// GraphNodeEphemeralCloseOrdering is ephemeral-resource-specific, not a
+	// general resource lifecycle concept, so only consult it when this
+	// transformer instance is actually acting on ephemeral resources.
+	if len(t.modes) == 0 || resourceModeIncluded(t.modes, addrs.EphemeralResourceMode) {
+		if err := t.connectEphemeralCloseOrdering(g, verts, closeNodesByAddr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// connectEphemeralCloseOrdering lets an ephemeral resource node declare
+// that other ephemeral resources' close nodes must not run until this
+// one's close node has run, once every close node in this transform has
+// been created. See GraphNodeEphemeralCloseOrdering.
+func (t *resourceLifecycleCloseTransformer) connectEphemeralCloseOrdering(g *Graph, verts []dag.Vertex, closeNodesByAddr map[string]dag.Vertex) error {
+	for _, v := range verts {
+		orderer, ok := v.(GraphNodeEphemeralCloseOrdering)
+		if !ok {
+			continue
+		}
+		configResource, ok := v.(GraphNodeConfigResource)
+		if !ok {
+			continue
+		}
+		addr := configResource.ResourceAddr()
+		if addr.Resource.Mode != addrs.EphemeralResourceMode {
+			continue
+		}
+		closeNode, ok := closeNodesByAddr[addr.String()]
+		if !ok {
+			continue
+		}
+
+		for _, depAddr := range orderer.EphemeralCloseBefore() {
+			depCloseNode, ok := closeNodesByAddr[depAddr.String()]
+			if !ok {
+				continue
+			}
+			log.Printf("[TRACE] resourceLifecycleCloseTransformer: ordering close of %s after close of %s", depAddr, addr)
+			g.Connect(dag.BasicEdge(depCloseNode, closeNode))
+		}
+	}
+
+	return nil
+}
+
+func resourceModeIncluded(modes []addrs.ResourceMode, mode addrs.ResourceMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
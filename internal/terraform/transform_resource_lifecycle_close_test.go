@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package terraform
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+	"github.com/hashicorp/terraform/internal/dag"
+)
+
+// testCloseableResourceNode is a minimal GraphNodeConfigResource used to
+// exercise resourceLifecycleCloseTransformer without depending on a real
+// resource mode's full node implementation.
+type testCloseableResourceNode struct {
+	addr addrs.ConfigResource
+}
+
+func (n *testCloseableResourceNode) ResourceAddr() addrs.ConfigResource {
+	return n.addr
+}
+
+func (n *testCloseableResourceNode) String() string {
+	return n.addr.String()
+}
+
+// testReferencerNode is a minimal GraphNodeReferencer, standing in for
+// whatever downstream node consumes a resource of a registered mode.
+type testReferencerNode struct {
+	name string
+}
+
+func (n *testReferencerNode) References() []*addrs.Reference {
+	return nil
+}
+
+func (n *testReferencerNode) String() string {
+	return n.name
+}
+
+// testModeClose is a fake close node for the mode registered below.
+type testModeClose struct {
+	forAddr addrs.ConfigResource
+}
+
+func (n *testModeClose) String() string {
+	return "testModeClose for " + n.forAddr.String()
+}
+
+// TestResourceLifecycleCloseTransformer_registeredMode demonstrates that a
+// resource mode other than ephemeral resources can register its own close
+// semantics with RegisterCloseTransformer and have
+// resourceLifecycleCloseTransformer pick it up without any changes to the
+// shared transformer, once some graph-building step constructs a
+// resourceLifecycleCloseTransformer covering that mode. Today the only
+// such step in the graph builders is ephemeralResourceCloseTransformer,
+// which only covers addrs.EphemeralResourceMode; a future resource mode
+// would also need its own graph-building step (or a broadened
+// ephemeralResourceCloseTransformer-like wrapper) to actually get a close
+// node inserted in a real plan or apply graph.
+func TestResourceLifecycleCloseTransformer_registeredMode(t *testing.T) {
+	RegisterCloseTransformer(addrs.DataResourceMode, func(v GraphNodeConfigResource) dag.Vertex {
+		return &testModeClose{forAddr: v.ResourceAddr()}
+	})
+	t.Cleanup(func() {
+		closeTransformersMu.Lock()
+		delete(closeTransformers, addrs.DataResourceMode)
+		closeTransformersMu.Unlock()
+	})
+
+	resourceAddr := addrs.ConfigResource{
+		Resource: addrs.Resource{
+			Mode: addrs.DataResourceMode,
+			Type: "test_thing",
+			Name: "example",
+		},
+		Module: addrs.RootModule,
+	}
+	resourceNode := &testCloseableResourceNode{addr: resourceAddr}
+	referencerNode := &testReferencerNode{name: "referencer"}
+
+	g := &Graph{}
+	g.Add(resourceNode)
+	g.Add(referencerNode)
+	g.Connect(dag.BasicEdge(referencerNode, resourceNode))
+
+	tr := &resourceLifecycleCloseTransformer{
+		modes: []addrs.ResourceMode{addrs.DataResourceMode},
+	}
+	if err := tr.Transform(g); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var closeNode *testModeClose
+	for _, v := range g.Vertices() {
+		if c, ok := v.(*testModeClose); ok {
+			closeNode = c
+		}
+	}
+	if closeNode == nil {
+		t.Fatal("no close node was added for the registered mode")
+	}
+	if closeNode.forAddr.String() != resourceAddr.String() {
+		t.Fatalf("close node built for wrong resource: got %s, want %s", closeNode.forAddr, resourceAddr)
+	}
+
+	downEdges := g.DownEdges(closeNode)
+	if !downEdges.Include(resourceNode) {
+		t.Error("close node is not connected to the resource node")
+	}
+	if !downEdges.Include(referencerNode) {
+		t.Error("close node is not connected to the referencer node")
+	}
+}